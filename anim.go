@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"os"
+
+	"github.com/chai2010/webp"
+)
+
+// tryConvertAnimatedGIF encodes an animated WebP from a multi-frame GIF. It
+// returns ok=false (with no error and no output written) when the GIF only
+// has a single frame, so the caller can fall back to the ordinary
+// single-frame path. alwaysAnimate forces the animated path even for
+// single-frame GIFs (used by --animated=always).
+func tryConvertAnimatedGIF(inputPath, outputPath string, quality float32, alwaysAnimate bool) (frames int, ok bool, err error) {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return 0, false, fmt.Errorf("opening gif: %w", err)
+	}
+	defer f.Close()
+
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		return 0, false, fmt.Errorf("decoding gif: %w", err)
+	}
+
+	if len(g.Image) < 2 && !alwaysAnimate {
+		return 0, false, nil
+	}
+
+	composed, delays, err := composeGIFFrames(g)
+	if err != nil {
+		return 0, false, err
+	}
+
+	data, err := encodeAnimatedFrames(composed, delays, g.LoopCount, quality)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return 0, false, fmt.Errorf("writing output: %w", err)
+	}
+
+	return len(composed), true, nil
+}
+
+// encodeAnimatedFrames WebP-encodes each already-composed frame and
+// assembles them into an animated WebP container (a RIFF ANIM/ANMF chunk
+// sequence), returning the raw file bytes.
+func encodeAnimatedFrames(composed []*image.RGBA, delays []int, loopCount int, quality float32) ([]byte, error) {
+	webpFrames := make([][]byte, len(composed))
+	for i, frame := range composed {
+		var buf bytes.Buffer
+		if err := webp.Encode(&buf, frame, &webp.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("encoding frame %d: %w", i, err)
+		}
+		webpFrames[i] = buf.Bytes()
+	}
+
+	bounds := composed[0].Bounds()
+	return buildAnimatedWebP(bounds.Dx(), bounds.Dy(), webpFrames, delays, loopCount)
+}
+
+// composeGIFFrames replays a decoded GIF's frames onto a persistent canvas,
+// honoring each frame's disposal method, and returns one fully-composed RGBA
+// image per frame along with its delay in 1/100ths of a second.
+func composeGIFFrames(g *gif.GIF) ([]*image.RGBA, []int, error) {
+	if len(g.Image) == 0 {
+		return nil, nil, fmt.Errorf("gif has no frames")
+	}
+
+	screen := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(screen)
+
+	frames := make([]*image.RGBA, 0, len(g.Image))
+	delays := make([]int, 0, len(g.Image))
+
+	var previous *image.RGBA
+	for i, frame := range g.Image {
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		out := cloneRGBA(canvas)
+		frames = append(frames, out)
+		delays = append(delays, g.Delay[i])
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			if previous != nil {
+				canvas = previous
+			}
+		}
+	}
+
+	return frames, delays, nil
+}
+
+// countTIFFPages walks a baseline TIFF's IFD chain (following each IFD's
+// "offset of next IFD" field) to report how many pages/sub-images the file
+// contains, without decoding any pixel data. It's used only to detect
+// multi-page TIFFs so convertImage can say so explicitly instead of silently
+// converting just the first page: animated TIFF is not implemented (the
+// vendored golang.org/x/image/tiff decoder only ever reads the first IFD),
+// unlike GIF where tryConvertAnimatedGIF handles every frame.
+func countTIFFPages(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 8)
+	if _, err := f.Read(header); err != nil {
+		return 0, fmt.Errorf("reading tiff header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch string(header[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, fmt.Errorf("not a tiff file")
+	}
+
+	pages := 0
+	offset := int64(order.Uint32(header[4:8]))
+	for offset != 0 {
+		pages++
+		if pages > 10000 {
+			return pages, fmt.Errorf("tiff IFD chain too long, possibly corrupt")
+		}
+
+		var countBuf [2]byte
+		if _, err := f.ReadAt(countBuf[:], offset); err != nil {
+			return pages, fmt.Errorf("reading IFD entry count: %w", err)
+		}
+		numEntries := int64(order.Uint16(countBuf[:]))
+
+		nextOffsetPos := offset + 2 + numEntries*12
+		var nextBuf [4]byte
+		if _, err := f.ReadAt(nextBuf[:], nextOffsetPos); err != nil {
+			return pages, fmt.Errorf("reading next-IFD offset: %w", err)
+		}
+		offset = int64(order.Uint32(nextBuf[:]))
+	}
+
+	return pages, nil
+}
+
+func cloneRGBA(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	return dst
+}
+
+// buildAnimatedWebP assembles a RIFF WEBP container with an ANIM chunk and
+// one ANMF chunk per frame, as described by the WebP container spec. This is
+// used instead of chai2010/webp's single-image Encode because that package
+// does not expose an animation encoder; each frame's bitstream chunk is
+// lifted out of a regular single-image WebP file produced by webp.Encode.
+func buildAnimatedWebP(width, height int, frames [][]byte, delaysCentiseconds []int, loopCount int) ([]byte, error) {
+	var payload bytes.Buffer
+
+	// ANIM chunk: background color (4 bytes, here fully transparent black)
+	// followed by loop count (uint16).
+	animChunk := make([]byte, 6)
+	binary.LittleEndian.PutUint32(animChunk[0:4], 0x00000000)
+	binary.LittleEndian.PutUint16(animChunk[4:6], uint16(loopCount))
+	writeChunk(&payload, "ANIM", animChunk)
+
+	for i, frame := range frames {
+		fourCC, bitstream, err := extractWebPBitstream(frame)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+
+		delayMs := delaysCentiseconds[i] * 10
+		var anmf bytes.Buffer
+		writeUint24(&anmf, 0) // frame X
+		writeUint24(&anmf, 0) // frame Y
+		writeUint24(&anmf, width-1)
+		writeUint24(&anmf, height-1)
+		writeUint24(&anmf, delayMs)
+		anmf.WriteByte(0x00) // reserved/blending/disposal flags: blend over, no dispose-to-background
+		writeChunk(&anmf, fourCC, bitstream)
+
+		writeChunk(&payload, "ANMF", anmf.Bytes())
+	}
+
+	vp8xFlags := byte(0x02) // ANIMATION_FLAG (see libwebp mux_types.h)
+	vp8x := make([]byte, 10)
+	vp8x[0] = vp8xFlags
+	putUint24(vp8x[4:7], width-1)
+	putUint24(vp8x[7:10], height-1)
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(0)) // patched below
+	out.WriteString("WEBP")
+	writeChunk(&out, "VP8X", vp8x)
+	out.Write(payload.Bytes())
+
+	data := out.Bytes()
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)-8))
+	return data, nil
+}
+
+// extractWebPBitstream strips the RIFF/WEBP container from a single-image
+// WebP file, returning the inner chunk's FourCC ("VP8 " or "VP8L") plus its
+// payload, so buildAnimatedWebP can re-wrap it inside an ANMF chunk.
+func extractWebPBitstream(webpFile []byte) (fourCC string, payload []byte, err error) {
+	if len(webpFile) < 20 || string(webpFile[0:4]) != "RIFF" || string(webpFile[8:12]) != "WEBP" {
+		return "", nil, fmt.Errorf("not a valid WebP file")
+	}
+	fourCC = string(webpFile[12:16])
+	size := binary.LittleEndian.Uint32(webpFile[16:20])
+	payload = webpFile[20 : 20+int(size)]
+	return fourCC, payload, nil
+}
+
+func writeChunk(buf *bytes.Buffer, fourCC string, data []byte) {
+	buf.WriteString(fourCC)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+func writeUint24(buf *bytes.Buffer, v int) {
+	b := make([]byte, 3)
+	putUint24(b, v)
+	buf.Write(b)
+}
+
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestBuildAnimatedWebPFlags guards against regressing the VP8X flags byte
+// back to ALPHA_FLAG (0x10): libwebp's WebPDemux rejects the container
+// unless ANIMATION_FLAG (0x02) is set, which makes every frame invisible to
+// real decoders even though our own chunk-writing code "succeeds".
+func TestBuildAnimatedWebPFlags(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			frame.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	data, err := encodeAnimatedFrames([]*image.RGBA{frame, frame, frame}, []int{10, 10, 10}, 0, 80)
+	if err != nil {
+		t.Fatalf("encodeAnimatedFrames: %v", err)
+	}
+
+	vp8x := findChunk(t, data, "VP8X")
+	if len(vp8x) < 1 {
+		t.Fatalf("VP8X chunk too short: %d bytes", len(vp8x))
+	}
+	if got := vp8x[0]; got&0x02 == 0 {
+		t.Fatalf("VP8X flags byte = 0x%02x, want ANIMATION_FLAG (0x02) set", got)
+	}
+
+	frameCount := 0
+	for _, fourCC := range iterChunks(t, data) {
+		if fourCC == "ANMF" {
+			frameCount++
+		}
+	}
+	if frameCount != 3 {
+		t.Fatalf("got %d ANMF chunks, want 3", frameCount)
+	}
+}
+
+// findChunk returns the payload of the first top-level RIFF chunk matching
+// fourCC, failing the test if it isn't found.
+func findChunk(t *testing.T, data []byte, fourCC string) []byte {
+	t.Helper()
+	pos := 12 // past "RIFF"+size+"WEBP"
+	for pos+8 <= len(data) {
+		cc := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		payload := data[pos+8 : pos+8+size]
+		if cc == fourCC {
+			return payload
+		}
+		pos += 8 + size + size%2
+	}
+	t.Fatalf("chunk %q not found", fourCC)
+	return nil
+}
+
+// iterChunks returns the FourCCs of every top-level RIFF chunk in data.
+func iterChunks(t *testing.T, data []byte) []string {
+	t.Helper()
+	var out []string
+	pos := 12
+	for pos+8 <= len(data) {
+		cc := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		out = append(out, cc)
+		pos += 8 + size + size%2
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the shape of a --config YAML file: top-level defaults that apply
+// to every input, plus an ordered list of per-glob Rules that can override
+// them for specific paths. A zero value for any top-level field means
+// "leave the CLI flag's value alone".
+type Config struct {
+	Quality     int    `yaml:"quality"`
+	Workers     int    `yaml:"workers"`
+	MaxWidth    int    `yaml:"max_width"`
+	MaxHeight   int    `yaml:"max_height"`
+	Fit         string `yaml:"fit"`
+	Animated    string `yaml:"animated"`
+	AnimQuality int    `yaml:"anim_quality"`
+	Dedup       string `yaml:"dedup"`
+	DedupLink   string `yaml:"dedup_link"`
+	Progress    string `yaml:"progress"`
+
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule overrides some of Config's top-level settings for inputs whose path,
+// relative to the input directory, matches Match - a doublestar glob, so
+// "photos/**" matches at any depth. Rules are evaluated in order and the
+// first match wins; a nil pointer field means "inherit the top-level/CLI
+// value" rather than "set to zero".
+type Rule struct {
+	Match        string `yaml:"match"`
+	Quality      *int   `yaml:"quality"`
+	MaxWidth     *int   `yaml:"max_width"`
+	MaxHeight    *int   `yaml:"max_height"`
+	Skip         bool   `yaml:"skip"`
+	OutputSubdir string `yaml:"output_subdir"`
+}
+
+// loadConfig reads and parses a --config YAML file.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// fileOverrides is the result of matching one input's relative path against
+// a Config's rules: the settings that should replace the run's defaults for
+// that file. The zero value means "no rule matched; use the top-level/CLI
+// defaults unchanged".
+type fileOverrides struct {
+	quality       *int
+	maxWidth      *int
+	maxHeight     *int
+	skip          bool
+	outputSubdir  string
+	matchedPrefix string
+}
+
+// matchRule finds the first rule in cfg whose Match glob matches relPath and
+// returns its overrides. relPath must use forward slashes (filepath.ToSlash)
+// since doublestar patterns are slash-separated regardless of OS.
+func matchRule(cfg *Config, relPath string) fileOverrides {
+	if cfg == nil {
+		return fileOverrides{}
+	}
+
+	for _, rule := range cfg.Rules {
+		matched, err := doublestar.Match(rule.Match, relPath)
+		if err != nil || !matched {
+			continue
+		}
+		return fileOverrides{
+			quality:       rule.Quality,
+			maxWidth:      rule.MaxWidth,
+			maxHeight:     rule.MaxHeight,
+			skip:          rule.Skip,
+			outputSubdir:  rule.OutputSubdir,
+			matchedPrefix: literalPrefix(rule.Match),
+		}
+	}
+
+	return fileOverrides{}
+}
+
+// literalPrefix returns the directory portion of a doublestar pattern that
+// precedes its first wildcard, e.g. "thumbs/**" -> "thumbs/" and
+// "photos/2024/*.jpg" -> "photos/2024/". It's used so that an OutputSubdir
+// override replaces the matched directory in the output path instead of
+// nesting under it (see resolveRuleOverrides). A pattern with no literal
+// directory prefix (e.g. "**/*.png") returns "".
+func literalPrefix(pattern string) string {
+	cut := strings.IndexAny(pattern, "*?[{")
+	if cut == -1 {
+		cut = len(pattern)
+	}
+	prefix := pattern[:cut]
+	if slash := strings.LastIndexByte(prefix, '/'); slash != -1 {
+		return prefix[:slash+1]
+	}
+	return ""
+}
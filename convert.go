@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveRuleOverrides applies cfg's first matching rule (if any) for f to
+// quality/preOpts and computes the resulting output path, so convertOne (the
+// --watch path) and decodeFile (the batch pipeline path) can't silently
+// drift from each other. When the matched rule sets OutputSubdir, the
+// matched rule's literal directory prefix is stripped from the output's
+// relative path so the subdir replaces it instead of nesting under it: a
+// rule matching "thumbs/**" with output_subdir "thumbs-out" sends
+// "thumbs/pic.png" to "<outputDir>/thumbs-out/pic.webp", not
+// ".../thumbs-out/thumbs/pic.webp".
+func resolveRuleOverrides(cfg *Config, inputDir, outputDir, f string, quality float32, preOpts preprocessOptions) (resolvedQuality float32, resolvedPreOpts preprocessOptions, outputPath string, skip bool) {
+	resolvedQuality = quality
+	resolvedPreOpts = preOpts
+
+	relPath, err := filepath.Rel(inputDir, f)
+	if err != nil {
+		relPath = filepath.Base(f)
+	}
+
+	if cfg == nil {
+		return resolvedQuality, resolvedPreOpts, joinOutputPath(outputDir, relPath), false
+	}
+
+	overrides := matchRule(cfg, filepath.ToSlash(relPath))
+	if overrides.skip {
+		return resolvedQuality, resolvedPreOpts, joinOutputPath(outputDir, relPath), true
+	}
+	if overrides.quality != nil {
+		resolvedQuality = float32(*overrides.quality)
+	}
+	if overrides.maxWidth != nil {
+		resolvedPreOpts.MaxWidth = *overrides.maxWidth
+	}
+	if overrides.maxHeight != nil {
+		resolvedPreOpts.MaxHeight = *overrides.maxHeight
+	}
+
+	effOutputDir := outputDir
+	effRelPath := relPath
+	if overrides.outputSubdir != "" {
+		effOutputDir = filepath.Join(outputDir, overrides.outputSubdir)
+		if overrides.matchedPrefix != "" {
+			trimmed := strings.TrimPrefix(filepath.ToSlash(relPath), overrides.matchedPrefix)
+			effRelPath = filepath.FromSlash(trimmed)
+		}
+	}
+
+	return resolvedQuality, resolvedPreOpts, joinOutputPath(effOutputDir, effRelPath), false
+}
+
+// conversionContext bundles the settings a single conversion needs,
+// independent of whether it's triggered by the initial directory scan or by
+// a --watch filesystem event.
+type conversionContext struct {
+	inputDir    string
+	outputDir   string
+	quality     float32
+	animated    string
+	animQuality float32
+	preOpts     preprocessOptions
+	dedupMode   string
+	dedupLink   string
+	dedupIdx    *DedupIndex
+	cfg         *Config
+}
+
+// convertOne resolves any --config rule overrides for f, runs the dedup
+// lookup (if enabled), then the normal encode path. dedupedFrom is
+// non-empty when the file was satisfied from the dedup index instead of
+// being re-encoded.
+func convertOne(ctx *conversionContext, f string) (result ConversionResult, dedupedFrom string) {
+	quality, preOpts, outputPath, skip := resolveRuleOverrides(ctx.cfg, ctx.inputDir, ctx.outputDir, f, ctx.quality, ctx.preOpts)
+	if skip {
+		return ConversionResult{
+			Input:   f,
+			Output:  outputPath,
+			Success: true,
+			Skipped: true,
+			Message: "Skipped by config rule",
+		}, ""
+	}
+
+	if ctx.dedupIdx != nil {
+		if h, err := computeContentHash(f, ctx.dedupMode); err == nil {
+			if existing, ok := ctx.dedupIdx.Lookup(h); ok {
+				if _, statErr := os.Stat(existing); statErr == nil {
+					if outputPath != existing {
+						if linkErr := linkDedupOutput(existing, outputPath, ctx.dedupLink); linkErr == nil {
+							var originalSize int64
+							if info, statErr := os.Stat(f); statErr == nil {
+								originalSize = info.Size()
+							}
+							return ConversionResult{
+								Input:        f,
+								Output:       outputPath,
+								Success:      true,
+								Deduplicated: true,
+								DedupSource:  existing,
+								OriginalSize: originalSize,
+							}, existing
+						}
+					}
+				}
+			}
+
+			result = convertImage(f, outputPath, quality, ctx.animated, ctx.animQuality, preOpts)
+			if result.Success {
+				ctx.dedupIdx.Store(h, result.Output)
+			}
+			return result, ""
+		}
+	}
+
+	return convertImage(f, outputPath, quality, ctx.animated, ctx.animQuality, preOpts), ""
+}
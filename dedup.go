@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const dedupIndexFilename = ".webp-index.json"
+
+// DedupIndex maps a content hash (see computeContentHash) to the output path
+// that already holds the encoded WebP for that content. It is persisted to
+// <outputDir>/.webp-index.json so incremental runs can skip re-encoding
+// known content even when the source path has changed.
+type DedupIndex struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+// loadDedupIndex reads the persisted index from outputDir, if present, and
+// returns an empty index otherwise.
+func loadDedupIndex(outputDir string) *DedupIndex {
+	idx := &DedupIndex{
+		path:    filepath.Join(outputDir, dedupIndexFilename),
+		entries: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(idx.path)
+	if err != nil {
+		return idx
+	}
+
+	var entries map[string]string
+	if err := json.Unmarshal(data, &entries); err == nil {
+		idx.entries = entries
+	}
+
+	return idx
+}
+
+// Lookup returns the output path previously recorded for hash, if any.
+func (idx *DedupIndex) Lookup(hash string) (string, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	out, ok := idx.entries[hash]
+	return out, ok
+}
+
+// Store records that hash's content is encoded at outputPath.
+func (idx *DedupIndex) Store(hash, outputPath string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.entries[hash] = outputPath
+}
+
+// Save persists the index to disk as JSON.
+func (idx *DedupIndex) Save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	data, err := json.MarshalIndent(idx.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(idx.path, data, 0644)
+}
+
+// computeContentHash hashes a source file for dedup purposes. In "bytes"
+// mode it hashes the raw file contents; otherwise it decodes the image and
+// hashes the normalized RGBA pixel data, so two bit-for-bit-different files
+// that decode to the same picture (e.g. re-saved JPEG vs PNG) still collide.
+// GIFs are hashed frame-by-frame (see hashGIFFrames) rather than through
+// image.Decode, which only ever returns a GIF's first frame: two different
+// animations sharing a first frame would otherwise hash identically and
+// dedup would link one file's output to the other's distinct animation.
+func computeContentHash(path, mode string) (string, error) {
+	if mode == "bytes" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		h := md5.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".gif" {
+		return hashGIFFrames(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+
+	b := img.Bounds()
+	rgba := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+
+	h := md5.New()
+	fmt.Fprintf(h, "%dx%d", b.Dx(), b.Dy())
+	h.Write(rgba.Pix)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashGIFFrames hashes every composed frame of a (possibly animated) GIF, so
+// two GIFs that only share a first frame don't collide. It composes frames
+// the same way tryConvertAnimatedGIF does, and folds in each frame's delay
+// plus the loop count so differing timing/looping also changes the hash.
+func hashGIFFrames(path string) (string, error) {
+	g, err := decodeGIFFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	frames, delays, err := composeGIFFrames(g)
+	if err != nil {
+		return "", err
+	}
+
+	h := md5.New()
+	fmt.Fprintf(h, "%dx%d;loop=%d", g.Config.Width, g.Config.Height, g.LoopCount)
+	for i, frame := range frames {
+		fmt.Fprintf(h, ";delay=%d;", delays[i])
+		h.Write(frame.Pix)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// linkDedupOutput makes newPath resolve to the same content as existingPath
+// via a hardlink, symlink, or plain copy, per linkMode.
+func linkDedupOutput(existingPath, newPath, linkMode string) error {
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return err
+	}
+
+	os.Remove(newPath)
+
+	switch linkMode {
+	case "sym":
+		rel, err := filepath.Rel(filepath.Dir(newPath), existingPath)
+		if err != nil {
+			rel = existingPath
+		}
+		return os.Symlink(rel, newPath)
+	case "copy":
+		return copyFile(existingPath, newPath)
+	default: // "hard"
+		if err := os.Link(existingPath, newPath); err != nil {
+			return copyFile(existingPath, newPath)
+		}
+		return nil
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestGIF writes an animated GIF whose frames are solid colors, to dir
+// under name.
+func writeTestGIF(t *testing.T, dir, name string, frameColors []color.Color) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	defer f.Close()
+
+	g := &gif.GIF{}
+	for _, c := range frameColors {
+		pal := color.Palette{color.White, c}
+		img := image.NewPaletted(image.Rect(0, 0, 2, 2), pal)
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 2; x++ {
+				img.Set(x, y, c)
+			}
+		}
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, 10)
+	}
+	if err := gif.EncodeAll(f, g); err != nil {
+		t.Fatalf("encode %s: %v", name, err)
+	}
+	return path
+}
+
+// TestComputeContentHashDistinguishesGIFAnimations guards against hashing
+// only a GIF's first frame (what image.Decode would do): two GIFs sharing
+// frame 1 but differing afterward must not collide, or --dedup=pixels would
+// link one file's output to the other's distinct animation.
+func TestComputeContentHashDistinguishesGIFAnimations(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestGIF(t, dir, "a.gif", []color.Color{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}})
+	b := writeTestGIF(t, dir, "b.gif", []color.Color{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}})
+
+	hashA, err := computeContentHash(a, "pixels")
+	if err != nil {
+		t.Fatalf("hash a: %v", err)
+	}
+	hashB, err := computeContentHash(b, "pixels")
+	if err != nil {
+		t.Fatalf("hash b: %v", err)
+	}
+
+	if hashA == hashB {
+		t.Fatalf("distinct animations sharing a first frame hashed identically: %s", hashA)
+	}
+}
+
+// TestComputeContentHashStableForIdenticalGIF checks that re-hashing the
+// same animated GIF is deterministic, so dedup actually recognizes true
+// duplicates.
+func TestComputeContentHashStableForIdenticalGIF(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestGIF(t, dir, "c.gif", []color.Color{color.RGBA{10, 20, 30, 255}, color.RGBA{40, 50, 60, 255}})
+
+	first, err := computeContentHash(path, "pixels")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	second, err := computeContentHash(path, "pixels")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if first != second {
+		t.Fatalf("hash not stable: %s != %s", first, second)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -39,6 +40,14 @@ type ConversionResult struct {
 	OriginalSize int64
 	NewSize      int64
 	Savings      float64
+	Frames       int
+	OrigWidth    int
+	OrigHeight   int
+	OutWidth     int
+	OutHeight    int
+	Deduplicated bool
+	DedupSource  string
+	Skipped      bool
 }
 
 func main() {
@@ -51,18 +60,124 @@ func main() {
 	inputDir := flag.String("i", "/app/images", "Input directory")
 	outputDir := flag.String("o", "/app/output", "Output directory")
 	workers := flag.Int("w", 0, "Number of parallel workers (default: CPU cores)")
+	animated := flag.String("animated", "auto", "Animated GIF handling: auto|always|never")
+	animQuality := flag.Float64("anim-quality", 80, "WebP quality for animated frames (1-100)")
+	maxWidth := flag.Int("max-width", 0, "Max output width in pixels, 0 = unlimited (never upscales)")
+	maxHeight := flag.Int("max-height", 0, "Max output height in pixels, 0 = unlimited (never upscales)")
+	fit := flag.String("fit", "contain", "Resize fit mode when over max dimensions: contain|cover|shrink-only")
+	stripExif := flag.Bool("strip-exif", false, "Strip EXIF orientation instead of auto-rotating the image")
+	dedup := flag.String("dedup", "", "Content-addressable dedup mode: \"\" (off), pixels, or bytes")
+	dedupLink := flag.String("dedup-link", "hard", "How to materialize duplicate outputs: hard|sym|copy")
+	progress := flag.String("progress", "auto", "Progress output: auto|bar|plain|json")
+	watch := flag.Bool("watch", false, "Keep running after the initial pass, converting new/modified files as they appear")
+	debounce := flag.Duration("debounce", 500*time.Millisecond, "Debounce window for --watch filesystem events")
+	mirrorDeletes := flag.Bool("mirror-deletes", false, "With --watch, delete the corresponding .webp when a source file is removed")
+	scanWorkers := flag.Int("scan-workers", 0, "Scan-stage workers, 0 = derived default")
+	decodeWorkers := flag.Int("decode-workers", 0, "Decode-stage workers, 0 = derived default (-w)")
+	encodeWorkers := flag.Int("encode-workers", 0, "Encode-stage workers, 0 = derived default (-w)")
+	writeWorkers := flag.Int("write-workers", 0, "Write-stage workers, 0 = derived default (-w / 2, at least 2)")
+	configPath := flag.String("config", "", "Path to a YAML config file with defaults and per-path rules (CLI flags override its top-level values)")
 	flag.Parse()
 
+	var cfg *Config
+	if *configPath != "" {
+		loaded, err := loadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg = loaded
+
+		setFlags := map[string]bool{}
+		flag.Visit(func(fl *flag.Flag) { setFlags[fl.Name] = true })
+
+		if !setFlags["q"] && cfg.Quality != 0 {
+			*quality = cfg.Quality
+		}
+		if !setFlags["w"] && cfg.Workers != 0 {
+			*workers = cfg.Workers
+		}
+		if !setFlags["max-width"] && cfg.MaxWidth != 0 {
+			*maxWidth = cfg.MaxWidth
+		}
+		if !setFlags["max-height"] && cfg.MaxHeight != 0 {
+			*maxHeight = cfg.MaxHeight
+		}
+		if !setFlags["fit"] && cfg.Fit != "" {
+			*fit = cfg.Fit
+		}
+		if !setFlags["animated"] && cfg.Animated != "" {
+			*animated = cfg.Animated
+		}
+		if !setFlags["anim-quality"] && cfg.AnimQuality != 0 {
+			*animQuality = float64(cfg.AnimQuality)
+		}
+		if !setFlags["dedup"] && cfg.Dedup != "" {
+			*dedup = cfg.Dedup
+		}
+		if !setFlags["dedup-link"] && cfg.DedupLink != "" {
+			*dedupLink = cfg.DedupLink
+		}
+		if !setFlags["progress"] && cfg.Progress != "" {
+			*progress = cfg.Progress
+		}
+	}
+
 	if *quality < 1 {
 		*quality = 1
 	} else if *quality > 100 {
 		*quality = 100
 	}
 
+	if *animated != "auto" && *animated != "always" && *animated != "never" {
+		fmt.Fprintf(os.Stderr, "Error: --animated must be one of auto|always|never, got %q\n", *animated)
+		os.Exit(1)
+	}
+
+	if *fit != "contain" && *fit != "cover" && *fit != "shrink-only" {
+		fmt.Fprintf(os.Stderr, "Error: --fit must be one of contain|cover|shrink-only, got %q\n", *fit)
+		os.Exit(1)
+	}
+
+	if *dedup != "" && *dedup != "pixels" && *dedup != "bytes" {
+		fmt.Fprintf(os.Stderr, "Error: --dedup must be one of pixels|bytes, got %q\n", *dedup)
+		os.Exit(1)
+	}
+
+	if *dedupLink != "hard" && *dedupLink != "sym" && *dedupLink != "copy" {
+		fmt.Fprintf(os.Stderr, "Error: --dedup-link must be one of hard|sym|copy, got %q\n", *dedupLink)
+		os.Exit(1)
+	}
+
+	if *progress != "auto" && *progress != "bar" && *progress != "plain" && *progress != "json" {
+		fmt.Fprintf(os.Stderr, "Error: --progress must be one of auto|bar|plain|json, got %q\n", *progress)
+		os.Exit(1)
+	}
+
+	if *animQuality < 1 {
+		*animQuality = 1
+	} else if *animQuality > 100 {
+		*animQuality = 100
+	}
+
 	if *workers <= 0 {
 		*workers = runtime.NumCPU()
 	}
 
+	defaultScan, defaultDecode, defaultEncode, defaultWrite := defaultPipelineWorkers(*workers)
+	if *scanWorkers <= 0 {
+		*scanWorkers = defaultScan
+	}
+	if *decodeWorkers <= 0 {
+		*decodeWorkers = defaultDecode
+	}
+	if *encodeWorkers <= 0 {
+		*encodeWorkers = defaultEncode
+	}
+	if *writeWorkers <= 0 {
+		*writeWorkers = defaultWrite
+	}
+
 	start := time.Now()
 	startTime := start.Format("2006-01-02 15:04:05 MST")
 
@@ -78,6 +193,21 @@ func main() {
 	fmt.Printf("  • Output directory: %s\n", *outputDir)
 	fmt.Printf("  • Quality:          %d%%\n", *quality)
 	fmt.Printf("  • Workers:          %d\n", *workers)
+	fmt.Printf("  • Pipeline:         scan=%d decode=%d encode=%d write=%d\n", *scanWorkers, *decodeWorkers, *encodeWorkers, *writeWorkers)
+	fmt.Printf("  • Animated GIFs:    %s\n", *animated)
+	if *maxWidth > 0 || *maxHeight > 0 {
+		fmt.Printf("  • Max dimensions:   %dx%d (%s)\n", *maxWidth, *maxHeight, *fit)
+	}
+	if *dedup != "" {
+		fmt.Printf("  • Dedup:            %s (link: %s)\n", *dedup, *dedupLink)
+	}
+	fmt.Printf("  • Progress:         %s\n", *progress)
+	if cfg != nil {
+		fmt.Printf("  • Config file:      %s (%d rule(s))\n", *configPath, len(cfg.Rules))
+	}
+	if *watch {
+		fmt.Printf("  • Watch mode:       on (debounce %s, mirror deletes: %v)\n", *debounce, *mirrorDeletes)
+	}
 	fmt.Println()
 
 	// Validate input directory
@@ -93,13 +223,56 @@ func main() {
 		os.Exit(1)
 	}
 
+	preOpts := preprocessOptions{
+		MaxWidth:  *maxWidth,
+		MaxHeight: *maxHeight,
+		Fit:       *fit,
+		StripEXIF: *stripExif,
+	}
+
+	var dedupIdx *DedupIndex
+	if *dedup != "" {
+		dedupIdx = loadDedupIndex(*outputDir)
+	}
+
+	watchCtx := &conversionContext{
+		inputDir:    *inputDir,
+		outputDir:   *outputDir,
+		quality:     float32(*quality),
+		animated:    *animated,
+		animQuality: float32(*animQuality),
+		preOpts:     preOpts,
+		dedupMode:   *dedup,
+		dedupLink:   *dedupLink,
+		dedupIdx:    dedupIdx,
+		cfg:         cfg,
+	}
+	startWatching := func(pr *progressReporter) {
+		if !*watch {
+			return
+		}
+		if pr == nil && resolveProgressMode(*progress) == "json" {
+			pr = newProgressReporter("json", 0)
+		}
+		if err := runWatch(watchCtx, watchOptions{debounce: *debounce, mirrorDeletes: *mirrorDeletes}, *workers, pr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if dedupIdx != nil {
+			if err := dedupIdx.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save dedup index: %v\n", err)
+			}
+		}
+	}
+
 	// Scan for image files
-	allFiles := getImageFiles(*inputDir)
+	allFiles := getImageFiles(*inputDir, *scanWorkers)
 	totalFound := len(allFiles)
 
 	if totalFound == 0 {
 		fmt.Printf("⚠ No images found in %s\n", *inputDir)
 		fmt.Println("  Supported formats: jpg, jpeg, png, gif, bmp, tiff, tif")
+		startWatching(nil)
 		return
 	}
 
@@ -115,55 +288,105 @@ func main() {
 
 	if totalFiles == 0 {
 		fmt.Println("  All files already converted. Nothing to do.")
+		startWatching(nil)
 		return
 	}
 
 	fmt.Printf("  Converting %d file(s)\n", totalFiles)
 	fmt.Println(strings.Repeat("-", 50))
 
+	progressMode := resolveProgressMode(*progress)
+	pr := newProgressReporter(progressMode, totalFiles)
+
 	// Parallel conversion
 	var counter atomic.Int64
 	var totalOriginal atomic.Int64
 	var totalNew atomic.Int64
 	var successful atomic.Int64
 	var failed atomic.Int64
+	var deduplicated atomic.Int64
+	var dedupBytesSaved atomic.Int64
+
+	pipelineOpts := pipelineOptions{
+		inputDir:      *inputDir,
+		outputDir:     *outputDir,
+		scanWorkers:   *scanWorkers,
+		decodeWorkers: *decodeWorkers,
+		encodeWorkers: *encodeWorkers,
+		writeWorkers:  *writeWorkers,
+		quality:       float32(*quality),
+		animated:      *animated,
+		animQuality:   float32(*animQuality),
+		preOpts:       preOpts,
+		dedupMode:     *dedup,
+		dedupLink:     *dedupLink,
+		dedupIdx:      dedupIdx,
+		cfg:           cfg,
+	}
 
-	sem := make(chan struct{}, *workers)
-	var wg sync.WaitGroup
+	var skippedByRule atomic.Int64
 
-	for _, file := range files {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(f string) {
-			defer wg.Done()
-			defer func() { <-sem }()
+	runPipeline(files, pipelineOpts, func(result ConversionResult) {
+		if result.Skipped {
+			skippedByRule.Add(1)
+			current := counter.Add(1)
+			line := fmt.Sprintf("[%d/%d] ⊘ %s: %s", current, totalFiles, filepath.Base(result.Input), result.Message)
+			pr.Report(result, line)
+			return
+		}
 
-			result := convertImage(f, *inputDir, *outputDir, float32(*quality))
+		if result.Deduplicated {
 			current := counter.Add(1)
-			filename := filepath.Base(result.Input)
-
-			if result.Success {
-				successful.Add(1)
-				totalOriginal.Add(result.OriginalSize)
-				totalNew.Add(result.NewSize)
-				fmt.Printf("[%d/%d] ✓ %s: %s → %s (%.2f%% saved)\n",
-					current, totalFiles, filename,
-					formatBytes(result.OriginalSize),
-					formatBytes(result.NewSize),
-					result.Savings)
-			} else {
-				failed.Add(1)
-				fmt.Printf("[%d/%d] ✗ %s: %s\n",
-					current, totalFiles, filename, result.Message)
+			deduplicated.Add(1)
+			dedupBytesSaved.Add(result.OriginalSize)
+			line := fmt.Sprintf("[%d/%d] \u29c8 %s: deduplicated (%s link to %s)",
+				current, totalFiles, filepath.Base(result.Input), *dedupLink, filepath.Base(result.DedupSource))
+			pr.Report(result, line)
+			return
+		}
+
+		current := counter.Add(1)
+		filename := filepath.Base(result.Input)
+
+		if result.Success {
+			successful.Add(1)
+			totalOriginal.Add(result.OriginalSize)
+			totalNew.Add(result.NewSize)
+			frameSuffix := ""
+			if result.Frames > 1 {
+				frameSuffix = fmt.Sprintf(" [%d frames]", result.Frames)
+			}
+			dimSuffix := ""
+			if result.OutWidth > 0 && (result.OutWidth != result.OrigWidth || result.OutHeight != result.OrigHeight) {
+				dimSuffix = fmt.Sprintf(" [%dx%d → %dx%d]", result.OrigWidth, result.OrigHeight, result.OutWidth, result.OutHeight)
 			}
-		}(file)
+			line := fmt.Sprintf("[%d/%d] ✓ %s: %s → %s (%.2f%% saved)%s%s",
+				current, totalFiles, filename,
+				formatBytes(result.OriginalSize),
+				formatBytes(result.NewSize),
+				result.Savings, frameSuffix, dimSuffix)
+			pr.Report(result, line)
+		} else {
+			failed.Add(1)
+			line := fmt.Sprintf("[%d/%d] ✗ %s: %s", current, totalFiles, filename, result.Message)
+			pr.Report(result, line)
+		}
+	})
+	pr.Stop()
+
+	if dedupIdx != nil {
+		if err := dedupIdx.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save dedup index: %v\n", err)
+		}
 	}
-	wg.Wait()
 
 	successCount := successful.Load()
 	failCount := failed.Load()
 	origTotal := totalOriginal.Load()
 	newTotal := totalNew.Load()
+	dedupCount := deduplicated.Load()
+	dedupSaved := dedupBytesSaved.Load()
+	skipCount := skippedByRule.Load()
 
 	endTime := time.Now().Format("2006-01-02 15:04:05 MST")
 	elapsed := time.Since(start)
@@ -175,6 +398,12 @@ func main() {
 	fmt.Printf("  • Total files:      %d\n", totalFiles)
 	fmt.Printf("  • Successful:       %d\n", successCount)
 	fmt.Printf("  • Failed:           %d\n", failCount)
+	if dedupIdx != nil {
+		fmt.Printf("  • Deduplicated:     %d (saved %s)\n", dedupCount, formatBytes(dedupSaved))
+	}
+	if skipCount > 0 {
+		fmt.Printf("  • Skipped by rule:  %d\n", skipCount)
+	}
 
 	if successCount > 0 {
 		var totalSavings float64
@@ -192,34 +421,133 @@ func main() {
 	fmt.Println()
 	fmt.Printf("Output directory: %s\n", *outputDir)
 	fmt.Println()
+
+	startWatching(pr)
 }
 
-func getImageFiles(inputDir string) []string {
+// getImageFiles walks inputDir for supported image files using scanWorkers
+// concurrent directory-listing goroutines (see dirScanQueue), then returns
+// the matches sorted for deterministic ordering regardless of which worker
+// found them first.
+func getImageFiles(inputDir string, scanWorkers int) []string {
+	if scanWorkers < 1 {
+		scanWorkers = 1
+	}
+
+	q := newDirScanQueue(inputDir)
+
+	var mu sync.Mutex
 	var files []string
-	filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if info.IsDir() {
-			return nil
-		}
-		ext := strings.ToLower(filepath.Ext(path))
-		if supportedExtensions[ext] {
-			files = append(files, path)
-		}
-		return nil
-	})
+
+	var wg sync.WaitGroup
+	wg.Add(scanWorkers)
+	for i := 0; i < scanWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				dir, ok := q.pop()
+				if !ok {
+					return
+				}
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					q.done()
+					continue
+				}
+				for _, entry := range entries {
+					full := filepath.Join(dir, entry.Name())
+					if entry.IsDir() {
+						q.push(full)
+						continue
+					}
+					ext := strings.ToLower(filepath.Ext(full))
+					if supportedExtensions[ext] {
+						mu.Lock()
+						files = append(files, full)
+						mu.Unlock()
+					}
+				}
+				q.done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(files)
 	return files
 }
 
+// dirScanQueue is an unbounded work queue of directories still to be listed,
+// used by getImageFiles so --scan-workers goroutines can walk a directory
+// tree concurrently: each worker may discover new subdirectories while
+// others are still draining the queue, which a fixed-size channel can't
+// support without risking a deadlock once it fills up.
+type dirScanQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   []string
+	pending int
+	closed  bool
+}
+
+func newDirScanQueue(root string) *dirScanQueue {
+	q := &dirScanQueue{items: []string{root}, pending: 1}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds a newly discovered directory to the queue.
+func (q *dirScanQueue) push(dir string) {
+	q.mu.Lock()
+	q.items = append(q.items, dir)
+	q.pending++
+	q.cond.Signal()
+	q.mu.Unlock()
+}
+
+// pop blocks until a directory is available or the queue is drained (ok ==
+// false), meaning every discovered directory has been fully processed.
+func (q *dirScanQueue) pop() (dir string, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return "", false
+	}
+	last := len(q.items) - 1
+	dir = q.items[last]
+	q.items = q.items[:last]
+	return dir, true
+}
+
+// done marks one directory (popped earlier) as fully processed, including
+// any subdirectories it pushed. Once every pushed directory has been marked
+// done, the queue closes and wakes any workers still waiting in pop.
+func (q *dirScanQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	if q.pending == 0 {
+		q.closed = true
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+}
+
 func getOutputPath(inputPath, inputDir, outputDir string) string {
 	rel, err := filepath.Rel(inputDir, inputPath)
 	if err != nil {
 		rel = filepath.Base(inputPath)
 	}
-	ext := filepath.Ext(rel)
-	out := filepath.Join(outputDir, rel[:len(rel)-len(ext)]+".webp")
-	return out
+	return joinOutputPath(outputDir, rel)
+}
+
+// joinOutputPath joins outputDir with relPath, swapping relPath's extension
+// for ".webp".
+func joinOutputPath(outputDir, relPath string) string {
+	ext := filepath.Ext(relPath)
+	return filepath.Join(outputDir, relPath[:len(relPath)-len(ext)]+".webp")
 }
 
 func filterAlreadyConverted(files []string, inputDir, outputDir string) ([]string, int) {
@@ -236,9 +564,7 @@ func filterAlreadyConverted(files []string, inputDir, outputDir string) ([]strin
 	return toConvert, skipped
 }
 
-func convertImage(inputPath, inputDir, outputDir string, quality float32) ConversionResult {
-	outputPath := getOutputPath(inputPath, inputDir, outputDir)
-
+func convertImage(inputPath, outputPath string, quality float32, animated string, animQuality float32, preOpts preprocessOptions) ConversionResult {
 	// Ensure output subdirectory exists
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		return ConversionResult{
@@ -261,6 +587,60 @@ func convertImage(inputPath, inputDir, outputDir string, quality float32) Conver
 	}
 	originalSize := info.Size()
 
+	ext := strings.ToLower(filepath.Ext(inputPath))
+	if ext == ".gif" && animated != "never" {
+		if anim, ok, err := tryConvertAnimatedGIF(inputPath, outputPath, animQuality, animated == "always"); err != nil {
+			return ConversionResult{
+				Input:        inputPath,
+				Output:       outputPath,
+				Success:      false,
+				Message:      fmt.Sprintf("Failed to encode animated WebP: %v", err),
+				OriginalSize: originalSize,
+			}
+		} else if ok {
+			outInfo, err := os.Stat(outputPath)
+			if err != nil {
+				return ConversionResult{
+					Input:        inputPath,
+					Output:       outputPath,
+					Success:      false,
+					Message:      fmt.Sprintf("Failed to stat output: %v", err),
+					OriginalSize: originalSize,
+				}
+			}
+			newSize := outInfo.Size()
+			var savings float64
+			if originalSize > 0 {
+				savings = float64(int((1.0-float64(newSize)/float64(originalSize))*10000)) / 100.0
+			}
+			return ConversionResult{
+				Input:        inputPath,
+				Output:       outputPath,
+				Success:      true,
+				Message:      "Converted successfully",
+				OriginalSize: originalSize,
+				NewSize:      newSize,
+				Savings:      savings,
+				Frames:       anim,
+			}
+		}
+		// ok == false means the GIF only had a single frame; fall through
+		// to the ordinary single-frame path below.
+	}
+
+	var tiffAnimNote string
+	if (ext == ".tiff" || ext == ".tif") && animated != "never" {
+		if pages, err := countTIFFPages(inputPath); err == nil && pages > 1 {
+			// Animated multi-page TIFF isn't implemented: x/image/tiff only
+			// ever decodes the first IFD, so there's no per-page decoder to
+			// drive an animated encode the way tryConvertAnimatedGIF does
+			// for GIF. Say so explicitly and fall through to converting the
+			// first page as a static image, rather than silently dropping
+			// the other pages with no indication anything was lost.
+			tiffAnimNote = fmt.Sprintf(" (multi-page TIFF animation not supported, converted page 1 of %d)", pages)
+		}
+	}
+
 	// Open and decode image
 	f, err := os.Open(inputPath)
 	if err != nil {
@@ -285,6 +665,8 @@ func convertImage(inputPath, inputDir, outputDir string, quality float32) Conver
 		}
 	}
 
+	img, origW, origH, outW, outH := preprocessImage(inputPath, img, preOpts)
+
 	// Encode to WebP
 	outFile, err := os.Create(outputPath)
 	if err != nil {
@@ -331,10 +713,15 @@ func convertImage(inputPath, inputDir, outputDir string, quality float32) Conver
 		Input:        inputPath,
 		Output:       outputPath,
 		Success:      true,
-		Message:      "Converted successfully",
+		Message:      "Converted successfully" + tiffAnimNote,
 		OriginalSize: originalSize,
 		NewSize:      newSize,
 		Savings:      savings,
+		Frames:       1,
+		OrigWidth:    origW,
+		OrigHeight:   origH,
+		OutWidth:     outW,
+		OutHeight:    outH,
 	}
 }
 
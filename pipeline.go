@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/chai2010/webp"
+)
+
+// pipelineOptions bundles the per-stage worker counts and the shared
+// conversion settings for the scan → decode → encode → write pipeline.
+type pipelineOptions struct {
+	inputDir  string
+	outputDir string
+
+	scanWorkers   int
+	decodeWorkers int
+	encodeWorkers int
+	writeWorkers  int
+
+	quality     float32
+	animated    string
+	animQuality float32
+	preOpts     preprocessOptions
+
+	dedupMode string
+	dedupLink string
+	dedupIdx  *DedupIndex
+
+	cfg *Config
+}
+
+// defaultPipelineWorkers derives sensible per-stage worker counts from
+// baseWorkers (normally runtime.NumCPU(), or the user's -w override).
+// Decoding and encoding are CPU-bound so they inherit the full count;
+// scanning is a single directory walk so it barely benefits from more than a
+// couple of goroutines, and writing is I/O-bound so it gets half (at least 2).
+func defaultPipelineWorkers(baseWorkers int) (scan, decode, encode, write int) {
+	return 2, baseWorkers, baseWorkers, maxInt(2, baseWorkers/2)
+}
+
+// decodedItem is what the decode stage hands to the encode stage: either a
+// single preprocessed image (the ordinary path) or a set of composed
+// animated GIF frames ready to be WebP-encoded.
+type decodedItem struct {
+	path         string
+	outputPath   string
+	originalSize int64
+	contentHash  string
+	quality      float32
+
+	img image.Image
+
+	animated      bool
+	animFrames    []*image.RGBA
+	animDelays    []int
+	animLoopCount int
+
+	origW, origH, outW, outH int
+}
+
+// encodedItem is what the encode stage hands to the write stage: the
+// WebP-ready bytes plus enough metadata to build the ConversionResult.
+type encodedItem struct {
+	path         string
+	outputPath   string
+	data         []byte
+	originalSize int64
+	contentHash  string
+	frames       int
+	origW, origH, outW, outH int
+}
+
+// runPipeline converts files through four overlapping stages connected by
+// bounded channels: scan (feeding paths in), decode (image.Decode plus
+// EXIF/resize preprocessing, or composing animated GIF frames, plus the
+// dedup lookup), encode (WebP, including the animated container format),
+// and write (fsync to outputDir). Bounding each stage's channel capacity
+// gives backpressure, so a slow write stage can't let every file's decoded
+// pixel buffer pile up in memory at once, and it lets CPU-bound encoding
+// overlap with I/O-bound decode/write instead of serializing behind a single
+// per-file goroutine. onResult is called once per input file, from whichever
+// stage's goroutine finishes (or fails) it, and must be safe for concurrent
+// use.
+func runPipeline(files []string, opts pipelineOptions, onResult func(ConversionResult)) {
+	paths := make(chan string, opts.scanWorkers*2)
+	decoded := make(chan decodedItem, opts.decodeWorkers*2)
+	encoded := make(chan encodedItem, opts.encodeWorkers*2)
+
+	var scanWG, decodeWG, encodeWG, writeWG sync.WaitGroup
+
+	scanWG.Add(1)
+	go func() {
+		defer scanWG.Done()
+		defer close(paths)
+		for _, f := range files {
+			paths <- f
+		}
+	}()
+
+	decodeWG.Add(opts.decodeWorkers)
+	for i := 0; i < opts.decodeWorkers; i++ {
+		go func() {
+			defer decodeWG.Done()
+			for path := range paths {
+				item, result, ok := decodeFile(path, opts)
+				if !ok {
+					onResult(result)
+					continue
+				}
+				decoded <- item
+			}
+		}()
+	}
+	go func() {
+		decodeWG.Wait()
+		close(decoded)
+	}()
+
+	encodeWG.Add(opts.encodeWorkers)
+	for i := 0; i < opts.encodeWorkers; i++ {
+		go func() {
+			defer encodeWG.Done()
+			for item := range decoded {
+				enc, result, ok := encodeDecodedItem(item, opts)
+				if !ok {
+					onResult(result)
+					continue
+				}
+				encoded <- enc
+			}
+		}()
+	}
+	go func() {
+		encodeWG.Wait()
+		close(encoded)
+	}()
+
+	writeWG.Add(opts.writeWorkers)
+	for i := 0; i < opts.writeWorkers; i++ {
+		go func() {
+			defer writeWG.Done()
+			for item := range encoded {
+				onResult(writeEncodedItem(item, opts))
+			}
+		}()
+	}
+
+	scanWG.Wait()
+	writeWG.Wait()
+}
+
+// decodeFile is the decode stage's per-file work: a dedup lookup (when
+// enabled), then either composing an animated GIF's frames or decoding and
+// preprocessing a single still image. ok is false when the file is fully
+// handled already (a dedup hit, or a terminal error) and result should be
+// reported as-is without further stages.
+func decodeFile(path string, opts pipelineOptions) (item decodedItem, result ConversionResult, ok bool) {
+	quality, preOpts, outputPath, skip := resolveRuleOverrides(opts.cfg, opts.inputDir, opts.outputDir, path, opts.quality, opts.preOpts)
+	if skip {
+		return decodedItem{}, ConversionResult{
+			Input:   path,
+			Output:  outputPath,
+			Success: true,
+			Skipped: true,
+			Message: "Skipped by config rule",
+		}, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return decodedItem{}, ConversionResult{
+			Input: path, Output: outputPath, Success: false,
+			Message: fmt.Sprintf("Cannot stat input: %v", err),
+		}, false
+	}
+	originalSize := info.Size()
+
+	var contentHash string
+	if opts.dedupIdx != nil {
+		if h, hashErr := computeContentHash(path, opts.dedupMode); hashErr == nil {
+			contentHash = h
+			if existing, found := opts.dedupIdx.Lookup(h); found && existing != outputPath {
+				if _, statErr := os.Stat(existing); statErr == nil {
+					if linkErr := linkDedupOutput(existing, outputPath, opts.dedupLink); linkErr == nil {
+						return decodedItem{}, ConversionResult{
+							Input:        path,
+							Output:       outputPath,
+							Success:      true,
+							OriginalSize: originalSize,
+							Deduplicated: true,
+							DedupSource:  existing,
+						}, false
+					}
+				}
+			}
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gif" && opts.animated != "never" {
+		g, gifErr := decodeGIFFile(path)
+		if gifErr != nil {
+			return decodedItem{}, ConversionResult{
+				Input: path, Output: outputPath, Success: false, OriginalSize: originalSize,
+				Message: fmt.Sprintf("Failed to decode gif: %v", gifErr),
+			}, false
+		}
+		if len(g.Image) >= 2 || opts.animated == "always" {
+			frames, delays, composeErr := composeGIFFrames(g)
+			if composeErr != nil {
+				return decodedItem{}, ConversionResult{
+					Input: path, Output: outputPath, Success: false, OriginalSize: originalSize,
+					Message: fmt.Sprintf("Failed to compose gif frames: %v", composeErr),
+				}, false
+			}
+			return decodedItem{
+				path:          path,
+				outputPath:    outputPath,
+				originalSize:  originalSize,
+				contentHash:   contentHash,
+				animated:      true,
+				animFrames:    frames,
+				animDelays:    delays,
+				animLoopCount: g.LoopCount,
+			}, ConversionResult{}, true
+		}
+		// Single-frame GIF under --animated=auto: fall through to the
+		// ordinary still-image path below.
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return decodedItem{}, ConversionResult{
+			Input: path, Output: outputPath, Success: false, OriginalSize: originalSize,
+			Message: fmt.Sprintf("Failed to open image: %v", err),
+		}, false
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return decodedItem{}, ConversionResult{
+			Input: path, Output: outputPath, Success: false, OriginalSize: originalSize,
+			Message: fmt.Sprintf("Failed to decode image: %v", err),
+		}, false
+	}
+
+	img, origW, origH, outW, outH := preprocessImage(path, img, preOpts)
+
+	return decodedItem{
+		path:         path,
+		outputPath:   outputPath,
+		originalSize: originalSize,
+		contentHash:  contentHash,
+		quality:      quality,
+		img:          img,
+		origW:        origW,
+		origH:        origH,
+		outW:         outW,
+		outH:         outH,
+	}, ConversionResult{}, true
+}
+
+func decodeGIFFile(path string) (*gif.GIF, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return gif.DecodeAll(f)
+}
+
+// encodeDecodedItem is the encode stage's per-item work: WebP-encode a still
+// image, or assemble an animated WebP from already-composed GIF frames.
+func encodeDecodedItem(item decodedItem, opts pipelineOptions) (enc encodedItem, result ConversionResult, ok bool) {
+	if item.animated {
+		data, err := encodeAnimatedFrames(item.animFrames, item.animDelays, item.animLoopCount, opts.animQuality)
+		if err != nil {
+			return encodedItem{}, ConversionResult{
+				Input: item.path, Output: item.outputPath, Success: false, OriginalSize: item.originalSize,
+				Message: fmt.Sprintf("Failed to encode animated WebP: %v", err),
+			}, false
+		}
+		return encodedItem{
+			path:         item.path,
+			outputPath:   item.outputPath,
+			data:         data,
+			originalSize: item.originalSize,
+			contentHash:  item.contentHash,
+			frames:       len(item.animFrames),
+		}, ConversionResult{}, true
+	}
+
+	var buf bytes.Buffer
+	if err := webp.Encode(&buf, item.img, &webp.Options{Quality: item.quality}); err != nil {
+		return encodedItem{}, ConversionResult{
+			Input: item.path, Output: item.outputPath, Success: false, OriginalSize: item.originalSize,
+			Message: fmt.Sprintf("Failed to encode WebP: %v", err),
+		}, false
+	}
+
+	return encodedItem{
+		path:         item.path,
+		outputPath:   item.outputPath,
+		data:         buf.Bytes(),
+		originalSize: item.originalSize,
+		contentHash:  item.contentHash,
+		frames:       1,
+		origW:        item.origW,
+		origH:        item.origH,
+		outW:         item.outW,
+		outH:         item.outH,
+	}, ConversionResult{}, true
+}
+
+// writeEncodedItem is the write stage's per-item work: fsync the encoded
+// bytes to outputDir and, on success, record the content hash in the dedup
+// index so later files with the same content can link to it instead of
+// re-encoding.
+func writeEncodedItem(item encodedItem, opts pipelineOptions) ConversionResult {
+	if err := os.MkdirAll(filepath.Dir(item.outputPath), 0755); err != nil {
+		return ConversionResult{
+			Input: item.path, Output: item.outputPath, Success: false, OriginalSize: item.originalSize,
+			Message: fmt.Sprintf("Failed to create output dir: %v", err),
+		}
+	}
+
+	outFile, err := os.Create(item.outputPath)
+	if err != nil {
+		return ConversionResult{
+			Input: item.path, Output: item.outputPath, Success: false, OriginalSize: item.originalSize,
+			Message: fmt.Sprintf("Failed to create output file: %v", err),
+		}
+	}
+	defer outFile.Close()
+
+	if _, err := outFile.Write(item.data); err != nil {
+		os.Remove(item.outputPath)
+		return ConversionResult{
+			Input: item.path, Output: item.outputPath, Success: false, OriginalSize: item.originalSize,
+			Message: fmt.Sprintf("Failed to write output: %v", err),
+		}
+	}
+	if err := outFile.Sync(); err != nil {
+		return ConversionResult{
+			Input: item.path, Output: item.outputPath, Success: false, OriginalSize: item.originalSize,
+			Message: fmt.Sprintf("Failed to fsync output: %v", err),
+		}
+	}
+
+	if opts.dedupIdx != nil && item.contentHash != "" {
+		opts.dedupIdx.Store(item.contentHash, item.outputPath)
+	}
+
+	newSize := int64(len(item.data))
+	var savings float64
+	if item.originalSize > 0 {
+		savings = float64(int((1.0-float64(newSize)/float64(item.originalSize))*10000)) / 100.0
+	}
+
+	frames := item.frames
+	if frames == 0 {
+		frames = 1
+	}
+
+	return ConversionResult{
+		Input:        item.path,
+		Output:       item.outputPath,
+		Success:      true,
+		Message:      "Converted successfully",
+		OriginalSize: item.originalSize,
+		NewSize:      newSize,
+		Savings:      savings,
+		Frames:       frames,
+		OrigWidth:    item.origW,
+		OrigHeight:   item.origH,
+		OutWidth:     item.outW,
+		OutHeight:    item.outH,
+	}
+}
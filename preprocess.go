@@ -0,0 +1,216 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"os"
+
+	xdraw "golang.org/x/image/draw"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// preprocessOptions bundles the auto-orientation and resize settings that
+// apply to every converted image.
+type preprocessOptions struct {
+	MaxWidth  int
+	MaxHeight int
+	Fit       string // contain|cover|shrink-only
+	// StripEXIF, when true, drops the source's EXIF orientation instead of
+	// auto-rotating the decoded image to match it. webp.Encode never writes
+	// metadata chunks regardless, so this only controls whether orientation
+	// is baked into the pixels.
+	StripEXIF bool
+}
+
+// preprocessImage optionally reads the EXIF orientation (JPEG/TIFF only) and
+// rotates or flips img to match, then resizes it per opts. It returns the
+// possibly replaced image along with its pixel dimensions before and after
+// resizing.
+func preprocessImage(inputPath string, img image.Image, opts preprocessOptions) (out image.Image, origW, origH, newW, newH int) {
+	origBounds := img.Bounds()
+	origW, origH = origBounds.Dx(), origBounds.Dy()
+
+	if !opts.StripEXIF {
+		if orientation := readEXIFOrientation(inputPath); orientation > 1 {
+			img = applyOrientation(img, orientation)
+		}
+	}
+
+	img = resizeToFit(img, opts.MaxWidth, opts.MaxHeight, opts.Fit)
+
+	newBounds := img.Bounds()
+	return img, origW, origH, newBounds.Dx(), newBounds.Dy()
+}
+
+// readEXIFOrientation returns the EXIF orientation tag (1-8) for path, or 1
+// (no transform needed) if the file has no readable EXIF data.
+func readEXIFOrientation(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 1
+	}
+	defer f.Close()
+
+	x, err := exif.Decode(f)
+	if err != nil {
+		return 1
+	}
+
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+
+	orientation, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+
+	return orientation
+}
+
+// applyOrientation rotates/flips img according to the EXIF orientation
+// values defined by the TIFF/EXIF spec (1-8).
+func applyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flipH(img)
+	case 3:
+		return rotate180(img)
+	case 4:
+		return flipV(img)
+	case 5:
+		return flipH(rotate90(img))
+	case 6:
+		return rotate90(img)
+	case 7:
+		return flipH(rotate270(img))
+	case 8:
+		return rotate270(img)
+	default:
+		return img
+	}
+}
+
+func rotate90(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.Set(b.Max.Y-1-y+b.Min.Y, x-b.Min.X, img.At(x, y))
+		}
+	}
+	return dst
+}
+
+func rotate180(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.Set(b.Max.X-1-x+b.Min.X, b.Max.Y-1-y+b.Min.Y, img.At(x, y))
+		}
+	}
+	return dst
+}
+
+func rotate270(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.Set(y-b.Min.Y, b.Max.X-1-x+b.Min.X, img.At(x, y))
+		}
+	}
+	return dst
+}
+
+func flipH(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.Set(b.Max.X-1-x+b.Min.X, y, img.At(x, y))
+		}
+	}
+	return dst
+}
+
+func flipV(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.Set(x, b.Max.Y-1-y+b.Min.Y, img.At(x, y))
+		}
+	}
+	return dst
+}
+
+// resizeToFit downscales img so it fits within maxWidth x maxHeight
+// according to fit, never upscaling. A zero maxWidth/maxHeight disables that
+// constraint. fit == "shrink-only" is an alias for "contain" that also skips
+// resizing entirely unless img already exceeds the bounds.
+func resizeToFit(img image.Image, maxWidth, maxHeight int, fit string) image.Image {
+	if maxWidth <= 0 && maxHeight <= 0 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	targetW, targetH := maxWidth, maxHeight
+	if targetW <= 0 {
+		targetW = w
+	}
+	if targetH <= 0 {
+		targetH = h
+	}
+
+	if w <= targetW && h <= targetH {
+		return img
+	}
+
+	scaleW := float64(targetW) / float64(w)
+	scaleH := float64(targetH) / float64(h)
+
+	var scale float64
+	switch fit {
+	case "cover":
+		scale = maxFloat(scaleW, scaleH)
+	default: // "contain", "shrink-only"
+		scale = minFloat(scaleW, scaleH)
+	}
+	if scale >= 1 {
+		return img
+	}
+
+	newW := maxInt(1, int(float64(w)*scale+0.5))
+	newH := maxInt(1, int(float64(h)*scale+0.5))
+
+	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// newLabeledImage returns a w x h RGBA image where pixel (x, y) is colored
+// uniquely by its coordinates, so transforms can be checked by comparing
+// colors rather than just dimensions.
+func newLabeledImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0, A: 255})
+		}
+	}
+	return img
+}
+
+// TestApplyOrientation5IsTranspose checks EXIF orientation 5 ("row 0 is
+// left, col 0 is top"), which per the spec is a pure transpose:
+// dst(x, y) = src(y, x).
+func TestApplyOrientation5IsTranspose(t *testing.T) {
+	w, h := 2, 3
+	src := newLabeledImage(w, h)
+	dst := applyOrientation(src, 5)
+
+	b := dst.Bounds()
+	if b.Dx() != h || b.Dy() != w {
+		t.Fatalf("got dimensions %dx%d, want %dx%d", b.Dx(), b.Dy(), h, w)
+	}
+	for y := 0; y < w; y++ {
+		for x := 0; x < h; x++ {
+			got := dst.At(x, y)
+			want := src.At(y, x)
+			if got != want {
+				t.Fatalf("dst(%d,%d) = %v, want src(%d,%d) = %v", x, y, got, y, x, want)
+			}
+		}
+	}
+}
+
+// TestApplyOrientation7IsTransverse checks EXIF orientation 7 ("row 0 is
+// right, col 0 is bottom"), which per the spec is the transverse:
+// dst(x, y) = src(W-1-y, H-1-x).
+func TestApplyOrientation7IsTransverse(t *testing.T) {
+	w, h := 2, 3
+	src := newLabeledImage(w, h)
+	dst := applyOrientation(src, 7)
+
+	b := dst.Bounds()
+	if b.Dx() != h || b.Dy() != w {
+		t.Fatalf("got dimensions %dx%d, want %dx%d", b.Dx(), b.Dy(), h, w)
+	}
+	for y := 0; y < w; y++ {
+		for x := 0; x < h; x++ {
+			got := dst.At(x, y)
+			want := src.At(w-1-y, h-1-x)
+			if got != want {
+				t.Fatalf("dst(%d,%d) = %v, want src(%d,%d) = %v", x, y, got, w-1-y, h-1-x, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progressTailSize is how many completed files the bar renderer keeps
+// visible below the summary line.
+const progressTailSize = 5
+
+// resolveProgressMode turns --progress's auto|bar|plain|json value into a
+// concrete mode. "auto" renders a live bar on a TTY and falls back to plain
+// per-file lines otherwise, so log capture in Docker/CI is preserved.
+func resolveProgressMode(flagValue string) string {
+	if flagValue != "auto" {
+		return flagValue
+	}
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		return "bar"
+	}
+	return "plain"
+}
+
+// progressReporter renders conversion progress as files complete. In "plain"
+// mode it just prints line as given (the tool's original per-file output).
+// In "json" mode it emits one NDJSON record per ConversionResult. In "bar"
+// mode it repaints a small block of lines in place showing overall progress,
+// ETA, throughput, and a rolling tail of recently completed files.
+type progressReporter struct {
+	mode  string
+	total int
+	start time.Time
+
+	mu        sync.Mutex
+	tail      []string
+	doneCount int
+	bytesRead int64
+
+	stopRender chan struct{}
+	renderDone chan struct{}
+}
+
+func newProgressReporter(mode string, total int) *progressReporter {
+	p := &progressReporter{
+		mode:  mode,
+		total: total,
+		start: time.Now(),
+	}
+	if p.mode == "bar" {
+		p.stopRender = make(chan struct{})
+		p.renderDone = make(chan struct{})
+		go p.renderLoop()
+	}
+	return p
+}
+
+// Report records one completed file. line is the fully formatted
+// human-readable line (as used by plain/bar); result is marshaled directly
+// in json mode.
+func (p *progressReporter) Report(result ConversionResult, line string) {
+	switch p.mode {
+	case "json":
+		data, err := json.Marshal(result)
+		if err == nil {
+			fmt.Println(string(data))
+		}
+		return
+	case "plain":
+		fmt.Println(line)
+		return
+	}
+
+	p.mu.Lock()
+	p.doneCount++
+	p.bytesRead += result.OriginalSize
+	p.tail = append(p.tail, line)
+	if len(p.tail) > progressTailSize {
+		p.tail = p.tail[len(p.tail)-progressTailSize:]
+	}
+	p.mu.Unlock()
+}
+
+// Stop halts the bar renderer (no-op for plain/json modes), leaving the
+// final state painted.
+func (p *progressReporter) Stop() {
+	if p.mode != "bar" {
+		return
+	}
+	close(p.stopRender)
+	<-p.renderDone
+}
+
+func (p *progressReporter) renderLoop() {
+	defer close(p.renderDone)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	painted := false
+	for {
+		select {
+		case <-ticker.C:
+			p.paint(&painted)
+		case <-p.stopRender:
+			p.paint(&painted)
+			return
+		}
+	}
+}
+
+func (p *progressReporter) paint(painted *bool) {
+	p.mu.Lock()
+	done := p.doneCount
+	bytesRead := p.bytesRead
+	tail := append([]string(nil), p.tail...)
+	p.mu.Unlock()
+
+	elapsed := time.Since(p.start)
+	var eta time.Duration
+	if done > 0 && p.total > done {
+		eta = (elapsed / time.Duration(done)) * time.Duration(p.total-done)
+	}
+
+	var throughput float64
+	if elapsed.Seconds() > 0 {
+		throughput = float64(bytesRead) / elapsed.Seconds()
+	}
+
+	if *painted {
+		fmt.Printf("\033[%dA", progressTailSize+1)
+	}
+	*painted = true
+
+	fmt.Printf("\033[K[%d/%d] files  elapsed %s  eta %s  %s/s\n",
+		done, p.total, formatDuration(elapsed), formatDuration(eta), formatBytes(int64(throughput)))
+
+	for i := 0; i < progressTailSize; i++ {
+		fmt.Print("\033[K")
+		if idx := len(tail) - progressTailSize + i; idx >= 0 {
+			fmt.Println(tail[idx])
+		} else {
+			fmt.Println()
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchOptions bundles the --watch-related flags.
+type watchOptions struct {
+	debounce      time.Duration
+	mirrorDeletes bool
+}
+
+// runWatch keeps the process alive after the initial conversion pass,
+// re-converting files as they're created or modified under ctx.inputDir and
+// (optionally) removing the corresponding .webp when a source file is
+// deleted or renamed away. Filesystem events are debounced per path so
+// editors that write a file in several operations only trigger one
+// conversion, then dispatched through a sem-bounded worker pool sized like
+// the initial scan's, rather than spawning an unbounded goroutine per event.
+// It blocks until interrupted (SIGINT/SIGTERM).
+func runWatch(ctx *conversionContext, watchOpts watchOptions, workers int, pr *progressReporter) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := addRecursive(watcher, ctx.inputDir); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", ctx.inputDir, err)
+	}
+
+	fmt.Printf("\nWatching %s for changes (debounce %s)... press Ctrl+C to stop\n", ctx.inputDir, watchOpts.debounce)
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	var pendingMu sync.Mutex
+	pending := make(map[string]*time.Timer)
+
+	dispatch := func(path string) {
+		ext := strings.ToLower(filepath.Ext(path))
+		if !supportedExtensions[ext] {
+			return
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if _, statErr := os.Stat(path); statErr != nil {
+				// Removed again before the debounce fired.
+				return
+			}
+
+			result, _ := convertOne(ctx, path)
+			reportWatchResult(pr, result)
+		}()
+	}
+
+	debounced := func(path string) {
+		pendingMu.Lock()
+		defer pendingMu.Unlock()
+		if t, ok := pending[path]; ok {
+			t.Stop()
+		}
+		pending[path] = time.AfterFunc(watchOpts.debounce, func() {
+			pendingMu.Lock()
+			delete(pending, path)
+			pendingMu.Unlock()
+			dispatch(path)
+		})
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-sigCh:
+			wg.Wait()
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				wg.Wait()
+				return nil
+			}
+			switch {
+			case event.Op&fsnotify.Create != 0:
+				if info, statErr := os.Stat(event.Name); statErr == nil && info.IsDir() {
+					if err := addRecursive(watcher, event.Name); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: failed to watch new directory %s: %v\n", event.Name, err)
+					}
+					continue
+				}
+				debounced(event.Name)
+			case event.Op&fsnotify.Write != 0:
+				debounced(event.Name)
+			case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				if watchOpts.mirrorDeletes {
+					mirrorDelete(ctx, event.Name)
+				}
+			}
+		case watchErr, ok := <-watcher.Errors:
+			if !ok {
+				wg.Wait()
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Watch error: %v\n", watchErr)
+		}
+	}
+}
+
+// addRecursive registers dir and all of its subdirectories with watcher, so
+// files created inside a freshly created subdirectory are also picked up.
+func addRecursive(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// mirrorDelete removes the .webp output corresponding to a deleted or
+// renamed-away source file, when --mirror-deletes is set. It runs the same
+// --config rule resolution as a real conversion would, so a rule's
+// output_subdir (or skip) is honored instead of assuming the source's
+// output sits directly under outputDir.
+func mirrorDelete(ctx *conversionContext, inputPath string) {
+	ext := strings.ToLower(filepath.Ext(inputPath))
+	if !supportedExtensions[ext] {
+		return
+	}
+	_, _, outPath, skip := resolveRuleOverrides(ctx.cfg, ctx.inputDir, ctx.outputDir, inputPath, ctx.quality, ctx.preOpts)
+	if skip {
+		return
+	}
+	if err := os.Remove(outPath); err == nil {
+		fmt.Printf("⌫ removed %s (source deleted)\n", filepath.Base(outPath))
+	}
+}
+
+// reportWatchResult prints one converted/failed file during --watch. In
+// json progress mode it goes through the same NDJSON reporter as the
+// initial scan; otherwise it's printed directly, since the bar renderer
+// from the initial scan has already been stopped by the time watching
+// starts.
+func reportWatchResult(pr *progressReporter, result ConversionResult) {
+	if pr != nil && pr.mode == "json" {
+		pr.Report(result, "")
+		return
+	}
+
+	filename := filepath.Base(result.Input)
+	switch {
+	case result.Skipped:
+		fmt.Printf("⊘ %s: %s\n", filename, result.Message)
+	case result.Deduplicated:
+		fmt.Printf("⧈ %s: deduplicated (link to %s)\n", filename, filepath.Base(result.DedupSource))
+	case result.Success:
+		fmt.Printf("✓ %s: %s → %s (%.2f%% saved)\n", filename,
+			formatBytes(result.OriginalSize), formatBytes(result.NewSize), result.Savings)
+	default:
+		fmt.Printf("✗ %s: %s\n", filename, result.Message)
+	}
+}